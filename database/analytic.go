@@ -0,0 +1,17 @@
+package database
+
+import "time"
+
+// Analytic represents a single tracked event stored in a DB.
+type Analytic struct {
+    Time          time.Time `json:"time"`
+    Event         string    `json:"event,omitempty"`
+    Path          string    `json:"path,omitempty"`
+    Ip            string    `json:"ip,omitempty"`
+    Platform      string    `json:"platform,omitempty"`
+    RefererDomain string    `json:"refererDomain,omitempty"`
+    CountryCode   string    `json:"countryCode,omitempty"`
+}
+
+// AnalyticsList is the response of a full Query over a DB.
+type AnalyticsList []Analytic
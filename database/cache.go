@@ -0,0 +1,41 @@
+package database
+
+import "sync"
+
+// Cache is a simple in-memory response cache, keyed by request URL, that is
+// cleared on every write (insert, bulk insert, DeleteDB) so reads never see
+// stale aggregates.
+type Cache struct {
+    mu    sync.RWMutex
+    items map[string]interface{}
+}
+
+func NewCache() *Cache {
+    return &Cache{
+        items: make(map[string]interface{}),
+    }
+}
+
+func (c *Cache) Get(key string) (interface{}, bool) {
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+
+    v, ok := c.items[key]
+    return v, ok
+}
+
+func (c *Cache) Add(key string, value interface{}) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    c.items[key] = value
+}
+
+// Clear drops every cached entry, e.g. after an Insert invalidates a DB's
+// aggregates.
+func (c *Cache) Clear() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    c.items = make(map[string]interface{})
+}
@@ -0,0 +1,23 @@
+package database
+
+import "context"
+
+// DB is the per-database query/insert contract implemented by each storage
+// backend (see sqlite.go). Every method takes a context derived from the
+// inbound HTTP request, so a client disconnect or request timeout cancels
+// the underlying SQL call instead of running it to completion regardless.
+type DB interface {
+    Query(ctx context.Context, timeRange TimeRange) (*AnalyticsList, error)
+    OverTime(ctx context.Context, interval int, timeRange TimeRange) (*Intervals, error)
+    OverTimeUniq(ctx context.Context, interval int, timeRange TimeRange) (*Intervals, error)
+    GroupBy(ctx context.Context, property string, timeRange TimeRange) (*AggregateList, error)
+    GroupByUniq(ctx context.Context, property string, timeRange TimeRange) (*AggregateList, error)
+    Insert(ctx context.Context, analytic Analytic) error
+    // BulkInsert inserts every analytic in a single transaction and reports,
+    // for each input index, the error (if any) encountered inserting it. When
+    // the second return value is nil, the slice has len(analytics) entries so
+    // callers can zip it back up with the records they sent; when it isn't,
+    // the slice is nil and the whole transaction was rolled back.
+    BulkInsert(ctx context.Context, analytics []Analytic) ([]error, error)
+    Close() error
+}
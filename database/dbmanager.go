@@ -0,0 +1,199 @@
+package database
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "sync/atomic"
+    "time"
+)
+
+func init() {
+    RegisterDriver("sqlite", func(dsn string) (Store, error) {
+        return NewDBManager(DBManagerOpts{Directory: dsn}), nil
+    })
+}
+
+// DBManagerOpts configures a DBManager.
+type DBManagerOpts struct {
+    // Directory under which each dbName gets its own SQLite file.
+    Directory string
+}
+
+// DBManager is the "sqlite" Store driver: one SQLite file per dbName, with
+// access to each serialized through an internal request/send/unlock
+// handshake so two handlers never touch the same *sql.DB concurrently.
+// That handshake is also the only goroutine allowed to touch pool: open()
+// and deleteFromPool() both run inside serve(), so DeleteDB is routed
+// through a deleteDB request rather than touching pool directly.
+type DBManager struct {
+    requestDB chan string
+    sendDB    chan DB
+    unlockDB  chan string
+    deleteDB  chan deleteRequest
+
+    cache *Cache
+
+    directory string
+    pool      map[string]DB
+
+    openDBs   int64 // atomic; reported via Describe
+    evictions int64 // atomic; reported via Describe
+
+    // requestWaitNanos/requestWaitCount accumulate the time callers spend
+    // blocked in WithDB waiting for serve() to hand back a DB, so Describe
+    // can report an average wait; both atomic.
+    requestWaitNanos int64
+    requestWaitCount int64
+}
+
+// deleteRequest asks serve() to evict dbName from pool, reporting back
+// whatever error removing its backing file produced.
+type deleteRequest struct {
+    dbName string
+    result chan error
+}
+
+// NewDBManager opens the manager and starts serializing DB access.
+func NewDBManager(opts DBManagerOpts) *DBManager {
+    m := &DBManager{
+        requestDB: make(chan string),
+        sendDB:    make(chan DB),
+        unlockDB:  make(chan string),
+        deleteDB:  make(chan deleteRequest),
+        cache:     NewCache(),
+        directory: opts.Directory,
+        pool:      make(map[string]DB),
+    }
+
+    go m.serve()
+
+    return m
+}
+
+func (m *DBManager) serve() {
+    for {
+        select {
+        case dbName, ok := <-m.requestDB:
+            if !ok {
+                return
+            }
+
+            db, err := m.open(dbName)
+            if err != nil {
+                m.sendDB <- nil
+                continue
+            }
+
+            m.sendDB <- db
+            <-m.unlockDB
+        case req := <-m.deleteDB:
+            req.result <- m.deleteFromPool(req.dbName)
+        }
+    }
+}
+
+func (m *DBManager) open(dbName string) (DB, error) {
+    if db, ok := m.pool[dbName]; ok {
+        return db, nil
+    }
+
+    db, err := OpenSQLite(m.path(dbName))
+    if err != nil {
+        return nil, err
+    }
+
+    m.pool[dbName] = db
+    atomic.AddInt64(&m.openDBs, 1)
+    return db, nil
+}
+
+// deleteFromPool closes and forgets dbName's pooled DB, if open, then
+// removes its backing directory. Only ever called from serve().
+func (m *DBManager) deleteFromPool(dbName string) error {
+    if db, ok := m.pool[dbName]; ok {
+        db.Close()
+        delete(m.pool, dbName)
+        atomic.AddInt64(&m.openDBs, -1)
+        atomic.AddInt64(&m.evictions, 1)
+    }
+
+    m.cache.Clear()
+    return os.RemoveAll(filepath.Join(m.directory, dbName))
+}
+
+// Describe implements metrics.Hook, reporting the number of SQLite files
+// currently held open in the pool, how many have been evicted via
+// DeleteDB, and the average time callers have spent blocked in WithDB
+// waiting for the requestDB/sendDB handshake.
+func (m *DBManager) Describe(report func(name string, value float64)) {
+    report("pool.open_dbs", float64(atomic.LoadInt64(&m.openDBs)))
+    report("pool.evictions", float64(atomic.LoadInt64(&m.evictions)))
+
+    count := atomic.LoadInt64(&m.requestWaitCount)
+    var avgWaitSeconds float64
+    if count > 0 {
+        avgWaitSeconds = (time.Duration(atomic.LoadInt64(&m.requestWaitNanos)) / time.Duration(count)).Seconds()
+    }
+    report("pool.request_wait_seconds_avg", avgWaitSeconds)
+}
+
+func (m *DBManager) path(dbName string) string {
+    return filepath.Join(m.directory, dbName, "analytics.db")
+}
+
+// WithDB serializes access to dbName's SQLite file and hands fn the open DB.
+// If ctx is cancelled before the lock is acquired, WithDB returns ctx.Err()
+// without ever calling fn.
+func (m *DBManager) WithDB(ctx context.Context, dbName string, fn func(DB) error) error {
+    waitStart := time.Now()
+
+    select {
+    case m.requestDB <- dbName:
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+
+    db := <-m.sendDB
+    atomic.AddInt64(&m.requestWaitNanos, int64(time.Since(waitStart)))
+    atomic.AddInt64(&m.requestWaitCount, 1)
+
+    // serve() doesn't wait for an unlock after a failed open, so only a
+    // DB that was actually handed out is released.
+    if db == nil {
+        return os.ErrNotExist
+    }
+    defer func() { m.unlockDB <- dbName }()
+
+    return fn(db)
+}
+
+func (m *DBManager) Cache() *Cache {
+    return m.cache
+}
+
+// DBExists reports whether dbName has a backing file on disk.
+func (m *DBManager) DBExists(dbName string) (bool, error) {
+    _, err := os.Stat(m.path(dbName))
+    if os.IsNotExist(err) {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    return true, nil
+}
+
+// DeleteDB closes and removes dbName's backing directory. The actual pool
+// mutation happens inside serve(), so it can never race a concurrent
+// WithDB's open().
+func (m *DBManager) DeleteDB(dbName string) error {
+    result := make(chan error, 1)
+    m.deleteDB <- deleteRequest{dbName: dbName, result: result}
+    return <-result
+}
+
+func (m *DBManager) Close() error {
+    close(m.requestDB)
+    return nil
+}
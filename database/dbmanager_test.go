@@ -0,0 +1,72 @@
+package database
+
+import (
+    "context"
+    "sync"
+    "testing"
+)
+
+func describeValues(m *DBManager) map[string]float64 {
+    values := map[string]float64{}
+    m.Describe(func(name string, value float64) {
+        values[name] = value
+    })
+    return values
+}
+
+// TestDBManagerDescribeReportsEvictionsAndWait covers the pool signals the
+// request asked for beyond pool.open_dbs: DeleteDB must be reflected as an
+// eviction, and a WithDB round trip must be reflected in the average
+// requestDB/sendDB wait time.
+func TestDBManagerDescribeReportsEvictionsAndWait(t *testing.T) {
+    m := NewDBManager(DBManagerOpts{Directory: t.TempDir()})
+    defer m.Close()
+
+    if err := m.WithDB(context.Background(), "db1", func(DB) error { return nil }); err != nil {
+        t.Fatalf("WithDB: %v", err)
+    }
+
+    values := describeValues(m)
+    if values["pool.open_dbs"] != 1 {
+        t.Errorf("pool.open_dbs = %v, want 1", values["pool.open_dbs"])
+    }
+    if values["pool.request_wait_seconds_avg"] < 0 {
+        t.Errorf("pool.request_wait_seconds_avg = %v, want >= 0", values["pool.request_wait_seconds_avg"])
+    }
+
+    if err := m.DeleteDB("db1"); err != nil {
+        t.Fatalf("DeleteDB: %v", err)
+    }
+
+    values = describeValues(m)
+    if values["pool.open_dbs"] != 0 {
+        t.Errorf("pool.open_dbs after delete = %v, want 0", values["pool.open_dbs"])
+    }
+    if values["pool.evictions"] != 1 {
+        t.Errorf("pool.evictions = %v, want 1", values["pool.evictions"])
+    }
+}
+
+// TestDBManagerConcurrentWithDBAndDeleteDB covers WithDB and DeleteDB
+// hammering the same dbName concurrently. Both used to mutate pool directly
+// from their own goroutines with no synchronization; under -race that's a
+// reported data race, and outside -race a map written from two goroutines
+// at once can crash the whole process.
+func TestDBManagerConcurrentWithDBAndDeleteDB(t *testing.T) {
+    m := NewDBManager(DBManagerOpts{Directory: t.TempDir()})
+    defer m.Close()
+
+    var wg sync.WaitGroup
+    for i := 0; i < 50; i++ {
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            m.WithDB(context.Background(), "db1", func(DB) error { return nil })
+        }()
+        go func() {
+            defer wg.Done()
+            m.DeleteDB("db1")
+        }()
+    }
+    wg.Wait()
+}
@@ -0,0 +1,261 @@
+package database
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+
+    _ "github.com/lib/pq"
+)
+
+func init() {
+    RegisterDriver("postgres", func(dsn string) (Store, error) {
+        return OpenPostgres(dsn)
+    })
+}
+
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS analytics (
+    db_name       TEXT NOT NULL,
+    time          BIGINT NOT NULL,
+    event         TEXT,
+    path          TEXT,
+    ip            TEXT,
+    platform      TEXT,
+    refererDomain TEXT,
+    countryCode   TEXT
+);
+CREATE INDEX IF NOT EXISTS analytics_db_name_time_idx ON analytics (db_name, time);
+`
+
+// PostgresStore is the "postgres" Store driver. Unlike DBManager it keeps
+// every dbName in a single shared `analytics` table, partitioned by a
+// db_name column, so many nodes can point at the same Postgres instance
+// instead of each owning its own SQLite files.
+type PostgresStore struct {
+    conn  *sql.DB
+    cache *Cache
+}
+
+// OpenPostgres connects to dsn and ensures the shared schema exists.
+func OpenPostgres(dsn string) (*PostgresStore, error) {
+    conn, err := sql.Open("postgres", dsn)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := conn.Ping(); err != nil {
+        conn.Close()
+        return nil, err
+    }
+
+    if _, err := conn.Exec(postgresSchema); err != nil {
+        conn.Close()
+        return nil, err
+    }
+
+    return &PostgresStore{conn: conn, cache: NewCache()}, nil
+}
+
+// WithDB hands fn a DB scoped to dbName. Postgres needs no per-dbName
+// locking: concurrent handlers just get distinct pooled connections, and
+// row-level locking inside Postgres itself keeps writes consistent. With no
+// lock to wait for, ctx is unused here; fn's queries take their own context.
+func (s *PostgresStore) WithDB(ctx context.Context, dbName string, fn func(DB) error) error {
+    return fn(&postgresDB{conn: s.conn, dbName: dbName})
+}
+
+func (s *PostgresStore) Cache() *Cache {
+    return s.cache
+}
+
+func (s *PostgresStore) DBExists(dbName string) (bool, error) {
+    var exists bool
+    err := s.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM analytics WHERE db_name = $1)`, dbName).Scan(&exists)
+    return exists, err
+}
+
+func (s *PostgresStore) DeleteDB(dbName string) error {
+    s.cache.Clear()
+    _, err := s.conn.Exec(`DELETE FROM analytics WHERE db_name = $1`, dbName)
+    return err
+}
+
+func (s *PostgresStore) Close() error {
+    return s.conn.Close()
+}
+
+// postgresDB is a DB scoped to a single db_name partition of the shared
+// analytics table.
+type postgresDB struct {
+    conn   *sql.DB
+    dbName string
+}
+
+func (db *postgresDB) Close() error {
+    // The underlying *sql.DB is owned by PostgresStore.
+    return nil
+}
+
+func (db *postgresDB) Insert(ctx context.Context, a Analytic) error {
+    _, err := db.conn.ExecContext(ctx,
+        `INSERT INTO analytics (db_name, time, event, path, ip, platform, refererDomain, countryCode)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+        db.dbName, a.Time.Unix(), a.Event, a.Path, a.Ip, a.Platform, a.RefererDomain, a.CountryCode,
+    )
+    return err
+}
+
+func (db *postgresDB) BulkInsert(ctx context.Context, analytics []Analytic) ([]error, error) {
+    tx, err := db.conn.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    stmt, err := tx.PrepareContext(ctx,
+        `INSERT INTO analytics (db_name, time, event, path, ip, platform, refererDomain, countryCode)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+    )
+    if err != nil {
+        tx.Rollback()
+        return nil, err
+    }
+    defer stmt.Close()
+
+    errs := make([]error, len(analytics))
+    for i, a := range analytics {
+        // A failed statement aborts a Postgres transaction, so each record
+        // gets its own savepoint to roll back to on failure.
+        if _, err := tx.ExecContext(ctx, `SAVEPOINT bulk_record`); err != nil {
+            tx.Rollback()
+            return nil, err
+        }
+        _, errs[i] = stmt.ExecContext(ctx, db.dbName, a.Time.Unix(), a.Event, a.Path, a.Ip, a.Platform, a.RefererDomain, a.CountryCode)
+        release := `RELEASE SAVEPOINT bulk_record`
+        if errs[i] != nil {
+            release = `ROLLBACK TO SAVEPOINT bulk_record`
+        }
+        if _, err := tx.ExecContext(ctx, release); err != nil {
+            tx.Rollback()
+            return nil, err
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return errs, nil
+}
+
+func (db *postgresDB) Query(ctx context.Context, timeRange TimeRange) (*AnalyticsList, error) {
+    rows, err := db.conn.QueryContext(ctx,
+        `SELECT time, event, path, ip, platform, refererDomain, countryCode
+         FROM analytics WHERE db_name = $1 AND time >= $2 AND time < $3`,
+        db.dbName, timeRange.Start.Unix(), timeRange.End.Unix(),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    analytics := AnalyticsList{}
+    for rows.Next() {
+        var a Analytic
+        var unixTime int64
+        if err := rows.Scan(&unixTime, &a.Event, &a.Path, &a.Ip, &a.Platform, &a.RefererDomain, &a.CountryCode); err != nil {
+            return nil, err
+        }
+        a.Time = unixToTime(unixTime)
+        analytics = append(analytics, a)
+    }
+
+    return &analytics, rows.Err()
+}
+
+func (db *postgresDB) OverTime(ctx context.Context, interval int, timeRange TimeRange) (*Intervals, error) {
+    return db.overTime(ctx, interval, timeRange, false)
+}
+
+func (db *postgresDB) OverTimeUniq(ctx context.Context, interval int, timeRange TimeRange) (*Intervals, error) {
+    return db.overTime(ctx, interval, timeRange, true)
+}
+
+func (db *postgresDB) overTime(ctx context.Context, interval int, timeRange TimeRange, unique bool) (*Intervals, error) {
+    countExpr := "COUNT(*)"
+    if unique {
+        countExpr = "COUNT(DISTINCT ip)"
+    }
+
+    query := fmt.Sprintf(
+        `SELECT (time - $1) / $2 AS bucket, %s
+         FROM analytics WHERE db_name = $3 AND time >= $1 AND time < $4
+         GROUP BY bucket ORDER BY bucket`,
+        countExpr,
+    )
+
+    rows, err := db.conn.QueryContext(ctx, query, timeRange.Start.Unix(), interval, db.dbName, timeRange.End.Unix())
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    intervals := Intervals{}
+    for rows.Next() {
+        var bucket int64
+        var count int
+        if err := rows.Scan(&bucket, &count); err != nil {
+            return nil, err
+        }
+
+        start := unixToTime(timeRange.Start.Unix() + bucket*int64(interval))
+        intervals = append(intervals, Interval{
+            Start: start,
+            End:   unixToTime(start.Unix() + int64(interval)),
+            Count: count,
+        })
+    }
+
+    return &intervals, rows.Err()
+}
+
+func (db *postgresDB) GroupBy(ctx context.Context, property string, timeRange TimeRange) (*AggregateList, error) {
+    return db.groupBy(ctx, property, timeRange, false)
+}
+
+func (db *postgresDB) GroupByUniq(ctx context.Context, property string, timeRange TimeRange) (*AggregateList, error) {
+    return db.groupBy(ctx, property, timeRange, true)
+}
+
+func (db *postgresDB) groupBy(ctx context.Context, property string, timeRange TimeRange, unique bool) (*AggregateList, error) {
+    if !isAllowedColumn(property) {
+        return nil, fmt.Errorf("invalid property: %s", property)
+    }
+
+    countExpr := "COUNT(*)"
+    if unique {
+        countExpr = "COUNT(DISTINCT ip)"
+    }
+
+    query := fmt.Sprintf(
+        `SELECT %s AS key, %s FROM analytics WHERE db_name = $1 AND time >= $2 AND time < $3 GROUP BY key`,
+        property, countExpr,
+    )
+
+    rows, err := db.conn.QueryContext(ctx, query, db.dbName, timeRange.Start.Unix(), timeRange.End.Unix())
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    aggregates := AggregateList{}
+    for rows.Next() {
+        var agg Aggregate
+        if err := rows.Scan(&agg.Key, &agg.Count); err != nil {
+            return nil, err
+        }
+        aggregates = append(aggregates, agg)
+    }
+
+    return &aggregates, rows.Err()
+}
@@ -0,0 +1,22 @@
+package database
+
+import "time"
+
+// Interval is one bucket of an OverTime/OverTimeUniq query.
+type Interval struct {
+    Start time.Time `json:"start"`
+    End   time.Time `json:"end"`
+    Count int       `json:"count"`
+}
+
+// Intervals is the response of an OverTime/OverTimeUniq query.
+type Intervals []Interval
+
+// Aggregate is one grouped key of a GroupBy/GroupByUniq query.
+type Aggregate struct {
+    Key   string `json:"key"`
+    Count int    `json:"count"`
+}
+
+// AggregateList is the response of a GroupBy/GroupByUniq query.
+type AggregateList []Aggregate
@@ -0,0 +1,12 @@
+package database
+
+import "context"
+
+// Searcher is implemented by storage backends that support full-text search
+// over path/event (currently SQLite via FTS5; see sqlite_fts5.go). A backend that
+// doesn't implement it can't serve GET /{dbName}/search.
+type Searcher interface {
+    // Search ranks analytics within timeRange by relevance to query, using
+    // each backend's own full-text index, and returns at most limit rows.
+    Search(ctx context.Context, query string, timeRange TimeRange, limit int) (*AnalyticsList, error)
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "os"
+    "path/filepath"
+
+    _ "github.com/mattn/go-sqlite3"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS analytics (
+    time          INTEGER NOT NULL,
+    event         TEXT,
+    path          TEXT,
+    ip            TEXT,
+    platform      TEXT,
+    refererDomain TEXT,
+    countryCode   TEXT
+);
+`
+
+// SQLiteDB is the default, per-file storage backend: one SQLite database per
+// dbName.
+type SQLiteDB struct {
+    conn *sql.DB
+}
+
+// OpenSQLite opens (creating if necessary) the SQLite file at path and
+// ensures its schema exists.
+func OpenSQLite(path string) (*SQLiteDB, error) {
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return nil, err
+    }
+
+    conn, err := sql.Open("sqlite3", path)
+    if err != nil {
+        return nil, err
+    }
+
+    if _, err := conn.Exec(schema); err != nil {
+        conn.Close()
+        return nil, err
+    }
+
+    // migrateFTS is a no-op unless this binary was built with -tags
+    // sqlite_fts5; see sqlite_fts5.go.
+    if err := migrateFTS(conn); err != nil {
+        conn.Close()
+        return nil, err
+    }
+
+    return &SQLiteDB{conn: conn}, nil
+}
+
+func (db *SQLiteDB) Close() error {
+    return db.conn.Close()
+}
+
+func (db *SQLiteDB) Insert(ctx context.Context, a Analytic) error {
+    _, err := db.conn.ExecContext(ctx,
+        `INSERT INTO analytics (time, event, path, ip, platform, refererDomain, countryCode)
+         VALUES (?, ?, ?, ?, ?, ?, ?)`,
+        a.Time.Unix(), a.Event, a.Path, a.Ip, a.Platform, a.RefererDomain, a.CountryCode,
+    )
+    return err
+}
+
+// BulkInsert inserts every analytic in a single transaction. A per-record
+// insert failure doesn't abort the transaction; it's recorded in the
+// returned error slice so the caller can report partial success.
+func (db *SQLiteDB) BulkInsert(ctx context.Context, analytics []Analytic) ([]error, error) {
+    tx, err := db.conn.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    stmt, err := tx.PrepareContext(ctx,
+        `INSERT INTO analytics (time, event, path, ip, platform, refererDomain, countryCode)
+         VALUES (?, ?, ?, ?, ?, ?, ?)`,
+    )
+    if err != nil {
+        tx.Rollback()
+        return nil, err
+    }
+    defer stmt.Close()
+
+    errs := make([]error, len(analytics))
+    for i, a := range analytics {
+        _, errs[i] = stmt.ExecContext(ctx, a.Time.Unix(), a.Event, a.Path, a.Ip, a.Platform, a.RefererDomain, a.CountryCode)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return errs, nil
+}
+
+func (db *SQLiteDB) Query(ctx context.Context, timeRange TimeRange) (*AnalyticsList, error) {
+    rows, err := db.conn.QueryContext(ctx,
+        `SELECT time, event, path, ip, platform, refererDomain, countryCode
+         FROM analytics WHERE time >= ? AND time < ?`,
+        timeRange.Start.Unix(), timeRange.End.Unix(),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    analytics := AnalyticsList{}
+    for rows.Next() {
+        var a Analytic
+        var unixTime int64
+        if err := rows.Scan(&unixTime, &a.Event, &a.Path, &a.Ip, &a.Platform, &a.RefererDomain, &a.CountryCode); err != nil {
+            return nil, err
+        }
+        a.Time = unixToTime(unixTime)
+        analytics = append(analytics, a)
+    }
+
+    return &analytics, rows.Err()
+}
+
+func (db *SQLiteDB) OverTime(ctx context.Context, interval int, timeRange TimeRange) (*Intervals, error) {
+    return db.overTime(ctx, interval, timeRange, false)
+}
+
+func (db *SQLiteDB) OverTimeUniq(ctx context.Context, interval int, timeRange TimeRange) (*Intervals, error) {
+    return db.overTime(ctx, interval, timeRange, true)
+}
+
+func (db *SQLiteDB) overTime(ctx context.Context, interval int, timeRange TimeRange, unique bool) (*Intervals, error) {
+    countExpr := "COUNT(*)"
+    if unique {
+        countExpr = "COUNT(DISTINCT ip)"
+    }
+
+    query := fmt.Sprintf(
+        `SELECT (time - ?) / ? AS bucket, %s
+         FROM analytics WHERE time >= ? AND time < ?
+         GROUP BY bucket ORDER BY bucket`,
+        countExpr,
+    )
+
+    rows, err := db.conn.QueryContext(ctx, query, timeRange.Start.Unix(), interval, timeRange.Start.Unix(), timeRange.End.Unix())
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    intervals := Intervals{}
+    for rows.Next() {
+        var bucket int64
+        var count int
+        if err := rows.Scan(&bucket, &count); err != nil {
+            return nil, err
+        }
+
+        start := unixToTime(timeRange.Start.Unix() + bucket*int64(interval))
+        intervals = append(intervals, Interval{
+            Start: start,
+            End:   unixToTime(start.Unix() + int64(interval)),
+            Count: count,
+        })
+    }
+
+    return &intervals, rows.Err()
+}
+
+func (db *SQLiteDB) GroupBy(ctx context.Context, property string, timeRange TimeRange) (*AggregateList, error) {
+    return db.groupBy(ctx, property, timeRange, false)
+}
+
+func (db *SQLiteDB) GroupByUniq(ctx context.Context, property string, timeRange TimeRange) (*AggregateList, error) {
+    return db.groupBy(ctx, property, timeRange, true)
+}
+
+func (db *SQLiteDB) groupBy(ctx context.Context, property string, timeRange TimeRange, unique bool) (*AggregateList, error) {
+    if !isAllowedColumn(property) {
+        return nil, fmt.Errorf("invalid property: %s", property)
+    }
+
+    countExpr := "COUNT(*)"
+    if unique {
+        countExpr = "COUNT(DISTINCT ip)"
+    }
+
+    query := fmt.Sprintf(
+        `SELECT %s AS key, %s FROM analytics WHERE time >= ? AND time < ? GROUP BY key`,
+        property, countExpr,
+    )
+
+    rows, err := db.conn.QueryContext(ctx, query, timeRange.Start.Unix(), timeRange.End.Unix())
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    aggregates := AggregateList{}
+    for rows.Next() {
+        var agg Aggregate
+        if err := rows.Scan(&agg.Key, &agg.Count); err != nil {
+            return nil, err
+        }
+        aggregates = append(aggregates, agg)
+    }
+
+    return &aggregates, rows.Err()
+}
+
+// isAllowedColumn guards against injecting the property into the SQL text
+// above: it must be one of the columns router.go is allowed to group by.
+func isAllowedColumn(property string) bool {
+    switch property {
+    case "countryCode", "platform", "refererDomain", "event":
+        return true
+    default:
+        return false
+    }
+}
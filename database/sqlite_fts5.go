@@ -0,0 +1,86 @@
+//go:build sqlite_fts5
+
+package database
+
+import (
+    "context"
+    "database/sql"
+)
+
+// ftsSchema indexes path/event/refererDomain for GET /{dbName}/search. It's
+// an external-content table over analytics (content_rowid keeps it in sync
+// with the base table's rowid instead of duplicating the indexed columns),
+// kept current by the AFTER INSERT trigger below. Only inserts are mirrored
+// into the index; there are no UPDATE or DELETE triggers.
+//
+// This file only builds with -tags sqlite_fts5, which compiles FTS5 support
+// into mattn/go-sqlite3; without that tag SQLiteDB doesn't implement
+// Searcher and GET /{dbName}/search returns errors.SearchUnsupported (see
+// sqlite_nofts5.go and web/router.go).
+const ftsSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS analytics_fts USING fts5(
+    path, event, refererDomain,
+    content='analytics', content_rowid='rowid'
+);
+CREATE TRIGGER IF NOT EXISTS analytics_fts_ai AFTER INSERT ON analytics BEGIN
+    INSERT INTO analytics_fts(rowid, path, event, refererDomain)
+    VALUES (new.rowid, new.path, new.event, new.refererDomain);
+END;
+`
+
+// migrateFTS creates analytics_fts and its maintenance trigger on DBs that
+// predate full-text search, then backfills it from the rows already in
+// analytics. It's a no-op on a DB that already has the index.
+func migrateFTS(conn *sql.DB) error {
+    var exists bool
+    err := conn.QueryRow(
+        `SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'analytics_fts')`,
+    ).Scan(&exists)
+    if err != nil {
+        return err
+    }
+    if exists {
+        return nil
+    }
+
+    if _, err := conn.Exec(ftsSchema); err != nil {
+        return err
+    }
+
+    _, err = conn.Exec(
+        `INSERT INTO analytics_fts(rowid, path, event, refererDomain)
+         SELECT rowid, path, event, refererDomain FROM analytics`,
+    )
+    return err
+}
+
+// Search ranks analytics in timeRange by relevance to query against the
+// path/event/refererDomain FTS5 index, best match first.
+func (db *SQLiteDB) Search(ctx context.Context, query string, timeRange TimeRange, limit int) (*AnalyticsList, error) {
+    rows, err := db.conn.QueryContext(ctx,
+        `SELECT a.time, a.event, a.path, a.ip, a.platform, a.refererDomain, a.countryCode
+         FROM analytics_fts f
+         JOIN analytics a ON a.rowid = f.rowid
+         WHERE analytics_fts MATCH ? AND a.time >= ? AND a.time < ?
+         ORDER BY bm25(analytics_fts)
+         LIMIT ?`,
+        query, timeRange.Start.Unix(), timeRange.End.Unix(), limit,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    analytics := AnalyticsList{}
+    for rows.Next() {
+        var a Analytic
+        var unixTime int64
+        if err := rows.Scan(&unixTime, &a.Event, &a.Path, &a.Ip, &a.Platform, &a.RefererDomain, &a.CountryCode); err != nil {
+            return nil, err
+        }
+        a.Time = unixToTime(unixTime)
+        analytics = append(analytics, a)
+    }
+
+    return &analytics, rows.Err()
+}
@@ -0,0 +1,15 @@
+//go:build !sqlite_fts5
+
+package database
+
+import "database/sql"
+
+// migrateFTS is a no-op in builds without the sqlite_fts5 tag: plain
+// mattn/go-sqlite3 doesn't compile in the FTS5 module, and creating
+// analytics_fts would fail with "no such module: fts5" on every OpenSQLite
+// call. SQLiteDB doesn't implement Searcher in this build, so
+// GET /{dbName}/search returns errors.SearchUnsupported instead of taking
+// down DB opens for everyone (see sqlite_fts5.go and web/router.go).
+func migrateFTS(conn *sql.DB) error {
+    return nil
+}
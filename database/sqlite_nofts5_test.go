@@ -0,0 +1,25 @@
+//go:build !sqlite_fts5
+
+package database
+
+import (
+    "path/filepath"
+    "testing"
+)
+
+// TestOpenSQLiteWithoutFTS5Tag guards against the regression where
+// migrateFTS unconditionally ran `CREATE VIRTUAL TABLE ... USING fts5(...)`
+// and broke every OpenSQLite call on a plain `go build`/`go test` (no such
+// module: fts5). Without the sqlite_fts5 tag, OpenSQLite must succeed and
+// SQLiteDB must not claim to implement Searcher.
+func TestOpenSQLiteWithoutFTS5Tag(t *testing.T) {
+    db, err := OpenSQLite(filepath.Join(t.TempDir(), "analytics.db"))
+    if err != nil {
+        t.Fatalf("OpenSQLite failed: %v", err)
+    }
+    defer db.Close()
+
+    if _, ok := interface{}(db).(Searcher); ok {
+        t.Fatal("SQLiteDB implements Searcher without the sqlite_fts5 build tag")
+    }
+}
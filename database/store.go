@@ -0,0 +1,49 @@
+package database
+
+import (
+    "context"
+    "fmt"
+)
+
+// Store is the backend-agnostic contract every storage driver (SQLite,
+// Postgres, ...) implements. web/router.go talks only to this interface, so
+// swapping --driver never changes HTTP behavior.
+type Store interface {
+    // DBExists reports whether dbName has any data.
+    DBExists(dbName string) (bool, error)
+    // DeleteDB drops every record belonging to dbName.
+    DeleteDB(dbName string) error
+    // WithDB serializes access to dbName and hands fn a DB scoped to it.
+    // SQLite uses this to take DBManager's lock, which hands out one DB at a
+    // time across all dbNames; Postgres instead relies on its own connection
+    // pool and row-level locking. ctx bounds how
+    // long WithDB itself waits for the lock; it does not cancel fn.
+    WithDB(ctx context.Context, dbName string, fn func(DB) error) error
+    // Cache is the response cache shared by every DB in this store.
+    Cache() *Cache
+    Close() error
+}
+
+// Driver opens a Store from a driver-specific DSN.
+type Driver func(dsn string) (Store, error)
+
+var drivers = map[string]Driver{}
+
+// RegisterDriver makes a driver available under name, for later use by Open.
+// It panics on a duplicate registration, following database/sql's own
+// driver registry convention.
+func RegisterDriver(name string, driver Driver) {
+    if _, exists := drivers[name]; exists {
+        panic("database: driver already registered: " + name)
+    }
+    drivers[name] = driver
+}
+
+// Open opens the named driver's Store against dsn.
+func Open(name, dsn string) (Store, error) {
+    driver, ok := drivers[name]
+    if !ok {
+        return nil, fmt.Errorf("database: unknown driver %q", name)
+    }
+    return driver(dsn)
+}
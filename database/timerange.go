@@ -0,0 +1,44 @@
+package database
+
+import (
+    "strconv"
+    "time"
+)
+
+// TimeRange bounds a query to the [Start, End) window. A zero Start means
+// "since the beginning of the DB"; NewTimeRange sets End to now when no end
+// is given.
+type TimeRange struct {
+    Start time.Time
+    End   time.Time
+}
+
+// NewTimeRange parses start/end query params, given as unix timestamps in
+// seconds, into a TimeRange.
+func NewTimeRange(start, end string) (TimeRange, error) {
+    timeRange := TimeRange{
+        End: time.Now(),
+    }
+
+    if len(start) > 0 {
+        sec, err := strconv.ParseInt(start, 10, 64)
+        if err != nil {
+            return timeRange, err
+        }
+        timeRange.Start = time.Unix(sec, 0)
+    }
+
+    if len(end) > 0 {
+        sec, err := strconv.ParseInt(end, 10, 64)
+        if err != nil {
+            return timeRange, err
+        }
+        timeRange.End = time.Unix(sec, 0)
+    }
+
+    return timeRange, nil
+}
+
+func unixToTime(sec int64) time.Time {
+    return time.Unix(sec, 0)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+
+    "github.com/azer/logger"
+    "github.com/oschwald/maxminddb-golang"
+
+    "github.com/GitbookIO/micro-analytics/database"
+    "github.com/GitbookIO/micro-analytics/web"
+)
+
+var log = logger.New("[Main]")
+
+func main() {
+    driver := flag.String("driver", "sqlite", "storage backend: sqlite or postgres")
+    dsn := flag.String("dsn", "./dbs", "sqlite: directory holding per-db files. postgres: connection string")
+    addr := flag.String("addr", ":6040", "address to listen on")
+    geolite2Path := flag.String("geolite2", "", "path to a GeoLite2-Country.mmdb file")
+    readTimeout := flag.Duration("read-timeout", 15*time.Second, "max duration for reading the entire request")
+    readHeaderTimeout := flag.Duration("read-header-timeout", 5*time.Second, "max duration for reading request headers")
+    writeTimeout := flag.Duration("write-timeout", 15*time.Second, "max duration for writing the response")
+    idleTimeout := flag.Duration("idle-timeout", 60*time.Second, "max duration a keep-alive connection may sit idle")
+    shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "max duration to wait for in-flight requests on shutdown")
+    flag.Parse()
+
+    store, err := database.Open(*driver, *dsn)
+    if err != nil {
+        log.Error("Failed to open %s store: %v", *driver, err)
+        return
+    }
+
+    var geolite2 *maxminddb.Reader
+    if len(*geolite2Path) > 0 {
+        geolite2, err = maxminddb.Open(*geolite2Path)
+        if err != nil {
+            log.Error("Failed to open Geolite2 DB: %v", err)
+            return
+        }
+        defer geolite2.Close()
+    }
+
+    server := web.NewServer(web.RouterOpts{
+        Store:          store,
+        Geolite2Reader: geolite2,
+        Version:        "unreleased",
+    }, web.ServerOpts{
+        Addr:              *addr,
+        ReadTimeout:       *readTimeout,
+        ReadHeaderTimeout: *readHeaderTimeout,
+        WriteTimeout:      *writeTimeout,
+        IdleTimeout:       *idleTimeout,
+    })
+
+    sig := make(chan os.Signal, 1)
+    signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+    // ListenAndServe blocks until Shutdown is called (or it fails to start),
+    // so it runs on its own goroutine reporting back over serveErr. This
+    // lets main block on Shutdown itself returning, instead of racing
+    // ListenAndServe's near-immediate return once Shutdown closes the
+    // listener (see http.Server.Shutdown's doc on this exact pitfall).
+    serveErr := make(chan error, 1)
+    go func() {
+        log.Info("Listening on %s (driver=%s)", *addr, *driver)
+        serveErr <- server.ListenAndServe()
+    }()
+
+    select {
+    case err := <-serveErr:
+        if err != nil {
+            log.Error("Server stopped: %v", err)
+        }
+    case <-sig:
+        log.Info("Shutting down...")
+
+        ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+        defer cancel()
+
+        // Shutdown only drains requests served by the net.Listener; it
+        // doesn't wait for hijacked connections, so the /live websocket
+        // subscribers from the pubsub broker are dropped immediately
+        // rather than drained.
+        if err := server.Shutdown(ctx); err != nil {
+            log.Error("Error during shutdown: %v", err)
+        }
+
+        <-serveErr
+    }
+}
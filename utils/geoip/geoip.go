@@ -0,0 +1,34 @@
+package geoip
+
+import (
+    "net"
+
+    "github.com/oschwald/maxminddb-golang"
+)
+
+type record struct {
+    Country struct {
+        IsoCode string `maxminddb:"iso_code"`
+    } `maxminddb:"country"`
+}
+
+// GeoIpLookup resolves an IP to an ISO country code using a Geolite2 reader.
+// It returns an empty string, with no error, when the reader is nil or the IP
+// can't be parsed or resolved.
+func GeoIpLookup(reader *maxminddb.Reader, ip string) (string, error) {
+    if reader == nil || len(ip) == 0 {
+        return "", nil
+    }
+
+    netIP := net.ParseIP(ip)
+    if netIP == nil {
+        return "", nil
+    }
+
+    var rec record
+    if err := reader.Lookup(netIP, &rec); err != nil {
+        return "", err
+    }
+
+    return rec.Country.IsoCode, nil
+}
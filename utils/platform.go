@@ -0,0 +1,21 @@
+package utils
+
+import "strings"
+
+// Platform returns a coarse platform label for a User-Agent string.
+func Platform(userAgent string) string {
+    switch {
+    case strings.Contains(userAgent, "Android"):
+        return "Android"
+    case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+        return "iOS"
+    case strings.Contains(userAgent, "Windows"):
+        return "Windows"
+    case strings.Contains(userAgent, "Mac OS"):
+        return "Mac"
+    case strings.Contains(userAgent, "Linux"):
+        return "Linux"
+    default:
+        return "Other"
+    }
+}
@@ -0,0 +1,126 @@
+package web
+
+import (
+    "crypto/rsa"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    jwt "github.com/dgrijalva/jwt-go"
+    "github.com/gorilla/mux"
+
+    "github.com/GitbookIO/micro-analytics/web/errors"
+)
+
+// Claims are the JWT claims micro-analytics understands: which dbs a token
+// may touch ("*" for all), and which HTTP-method scopes ("read", "write",
+// "delete", or "*") it grants on them.
+type Claims struct {
+    jwt.StandardClaims
+    Dbs    []string `json:"dbs"`
+    Scopes []string `json:"scopes"`
+}
+
+// scopesByMethod maps an HTTP method to the scope a token needs to use it.
+var scopesByMethod = map[string]string{
+    "GET":    "read",
+    "POST":   "write",
+    "DELETE": "delete",
+}
+
+// jwtMiddleware rejects requests whose bearer token doesn't cover the
+// request's dbName path variable and HTTP method. Requests with no dbName
+// path variable (the welcome route, /_auth/token) pass through unchecked.
+func jwtMiddleware(publicKey interface{}, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        dbName := mux.Vars(req)["dbName"]
+        if len(dbName) == 0 {
+            next.ServeHTTP(w, req)
+            return
+        }
+
+        claims, err := parseBearerToken(req, publicKey)
+        if err != nil {
+            renderError(w, &errors.Unauthorized)
+            return
+        }
+
+        if !tokenCovers(claims.Dbs, dbName) {
+            renderError(w, &errors.Forbidden)
+            return
+        }
+
+        scope, ok := scopesByMethod[req.Method]
+        if !ok || !tokenCovers(claims.Scopes, scope) {
+            renderError(w, &errors.Forbidden)
+            return
+        }
+
+        next.ServeHTTP(w, req)
+    })
+}
+
+func parseBearerToken(req *http.Request, publicKey interface{}) (*Claims, error) {
+    header := req.Header.Get("Authorization")
+    raw := strings.TrimPrefix(header, "Bearer ")
+    if len(raw) == 0 || raw == header {
+        return nil, jwt.NewValidationError("missing bearer token", jwt.ValidationErrorMalformed)
+    }
+
+    claims := &Claims{}
+    if _, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+        return keyFor(token, publicKey)
+    }); err != nil {
+        return nil, err
+    }
+
+    return claims, nil
+}
+
+// keyFor pins the signing method implied by publicKey's type before handing
+// the key back to jwt-go, so a token can't pick its own algorithm. Without
+// this, an RS256 deployment is forgeable: an attacker mints an HS256 token
+// and signs it with the (public, non-secret) RSA key bytes, which jwt-go
+// would otherwise accept as a valid HMAC signature.
+func keyFor(token *jwt.Token, publicKey interface{}) (interface{}, error) {
+    switch key := publicKey.(type) {
+    case *rsa.PublicKey:
+        if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+            return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+        }
+        return key, nil
+    case []byte:
+        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+            return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+        }
+        return key, nil
+    default:
+        return nil, fmt.Errorf("unsupported JWTPublicKey type: %T", publicKey)
+    }
+}
+
+// tokenCovers reports whether values contains needle or the "*" wildcard.
+func tokenCovers(values []string, needle string) bool {
+    for _, v := range values {
+        if v == "*" || v == needle {
+            return true
+        }
+    }
+    return false
+}
+
+// mintToken signs a new HS256 token scoped to dbs/scopes, valid for ttl.
+func mintToken(signingKey []byte, dbs, scopes []string, ttl time.Duration) (string, error) {
+    claims := Claims{
+        StandardClaims: jwt.StandardClaims{
+            IssuedAt:  time.Now().Unix(),
+            ExpiresAt: time.Now().Add(ttl).Unix(),
+        },
+        Dbs:    dbs,
+        Scopes: scopes,
+    }
+
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+    return token.SignedString(signingKey)
+}
@@ -0,0 +1,59 @@
+package web
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "net/http"
+    "testing"
+    "time"
+
+    jwt "github.com/dgrijalva/jwt-go"
+)
+
+// TestParseBearerTokenRejectsAlgorithmConfusion guards against the
+// RS256/HS256 key-confusion forgery: a token claiming HS256 but "signed"
+// using the deployment's RSA public key bytes as the HMAC secret must not
+// verify just because the keyfunc used to hand back whatever key it was
+// given regardless of the token's algorithm.
+func TestParseBearerTokenRejectsAlgorithmConfusion(t *testing.T) {
+    rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatalf("generate RSA key: %v", err)
+    }
+    publicKey := &rsaKey.PublicKey
+    publicKeyBytes := x509.MarshalPKCS1PublicKey(publicKey)
+
+    forgedToken := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+        Dbs:    []string{"*"},
+        Scopes: []string{"*"},
+    })
+    forged, err := forgedToken.SignedString(publicKeyBytes)
+    if err != nil {
+        t.Fatalf("sign forged token: %v", err)
+    }
+
+    req, _ := http.NewRequest("GET", "/", nil)
+    req.Header.Set("Authorization", "Bearer "+forged)
+
+    if _, err := parseBearerToken(req, publicKey); err == nil {
+        t.Fatal("forged HS256 token verified against an RSA public key")
+    }
+}
+
+// TestParseBearerTokenAcceptsMatchingAlgorithm ensures the algorithm pin
+// doesn't also reject legitimate tokens signed with the expected method.
+func TestParseBearerTokenAcceptsMatchingAlgorithm(t *testing.T) {
+    signingKey := []byte("test-signing-key")
+    signed, err := mintToken(signingKey, []string{"*"}, []string{"*"}, time.Minute)
+    if err != nil {
+        t.Fatalf("mint token: %v", err)
+    }
+
+    req, _ := http.NewRequest("GET", "/", nil)
+    req.Header.Set("Authorization", "Bearer "+signed)
+
+    if _, err := parseBearerToken(req, signingKey); err != nil {
+        t.Fatalf("legitimate HS256 token rejected: %v", err)
+    }
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+    "bufio"
+    "encoding/json"
+    "io"
+)
+
+// bulkBatchSize caps how many decoded records are buffered before being
+// flushed to the DB, so a /bulk request's memory use doesn't scale with the
+// size of the uploaded body.
+const bulkBatchSize = 500
+
+// bulkMaxErrors caps how many error strings bulkInsertResult.Errors
+// accumulates. A stream that fails systematically (bad schema, disk full)
+// still increments Failed for every record, but stops growing Errors past
+// the cap, so it can't defeat the point of streaming the upload in bounded
+// batches.
+const bulkMaxErrors = 20
+
+// bulkInsertResult is the per-request summary returned by POST /{dbName}/bulk:
+// how many records were accepted, how many failed, and up to bulkMaxErrors
+// of the failure messages. It doesn't say which records failed.
+type bulkInsertResult struct {
+    Inserted int      `json:"inserted"`
+    Failed   int      `json:"failed"`
+    Errors   []string `json:"errors,omitempty"`
+}
+
+// addError records n more failures, keeping the first bulkMaxErrors error
+// strings and silently counting the rest in Failed.
+func (r *bulkInsertResult) addError(msg string, n int) {
+    r.Failed += n
+    if len(r.Errors) < bulkMaxErrors {
+        r.Errors = append(r.Errors, msg)
+    }
+}
+
+// streamBulkRecords stream-parses a request body holding either a JSON array
+// or newline-delimited JSON objects, calling onRecord for each one as it's
+// decoded so memory use stays bounded regardless of body size.
+func streamBulkRecords(body io.Reader, onRecord func(PostAnalytic) error) error {
+    br := bufio.NewReader(body)
+
+    first, err := peekFirstNonSpace(br)
+    if err == io.EOF {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    dec := json.NewDecoder(br)
+
+    if first == '[' {
+        if _, err := dec.Token(); err != nil {
+            return err
+        }
+        for dec.More() {
+            var rec PostAnalytic
+            if err := dec.Decode(&rec); err != nil {
+                return err
+            }
+            if err := onRecord(rec); err != nil {
+                return err
+            }
+        }
+        _, err := dec.Token()
+        return err
+    }
+
+    for {
+        var rec PostAnalytic
+        err := dec.Decode(&rec)
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        if err := onRecord(rec); err != nil {
+            return err
+        }
+    }
+}
+
+// peekFirstNonSpace returns the first non-whitespace byte of br without
+// consuming anything past it.
+func peekFirstNonSpace(br *bufio.Reader) (byte, error) {
+    for {
+        b, err := br.Peek(1)
+        if err != nil {
+            return 0, err
+        }
+
+        switch b[0] {
+        case ' ', '\t', '\n', '\r':
+            br.ReadByte()
+        default:
+            return b[0], nil
+        }
+    }
+}
@@ -0,0 +1,142 @@
+package web
+
+import (
+    "bytes"
+    "compress/gzip"
+    "strings"
+    "testing"
+)
+
+// TestStreamBulkRecordsArray covers the JSON-array body shape: every element
+// is decoded and handed to onRecord in order.
+func TestStreamBulkRecordsArray(t *testing.T) {
+    body := strings.NewReader(`[{"event":"a"},{"event":"b"},{"event":"c"}]`)
+
+    var events []string
+    err := streamBulkRecords(body, func(rec PostAnalytic) error {
+        events = append(events, rec.Event)
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("streamBulkRecords: %v", err)
+    }
+
+    want := []string{"a", "b", "c"}
+    if len(events) != len(want) {
+        t.Fatalf("events = %v, want %v", events, want)
+    }
+    for i := range want {
+        if events[i] != want[i] {
+            t.Errorf("events[%d] = %q, want %q", i, events[i], want[i])
+        }
+    }
+}
+
+// TestStreamBulkRecordsNDJSON covers the newline-delimited-JSON body shape.
+func TestStreamBulkRecordsNDJSON(t *testing.T) {
+    body := strings.NewReader("{\"event\":\"a\"}\n{\"event\":\"b\"}\n{\"event\":\"c\"}\n")
+
+    var events []string
+    err := streamBulkRecords(body, func(rec PostAnalytic) error {
+        events = append(events, rec.Event)
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("streamBulkRecords: %v", err)
+    }
+
+    want := []string{"a", "b", "c"}
+    if len(events) != len(want) {
+        t.Fatalf("events = %v, want %v", events, want)
+    }
+    for i := range want {
+        if events[i] != want[i] {
+            t.Errorf("events[%d] = %q, want %q", i, events[i], want[i])
+        }
+    }
+}
+
+// TestStreamBulkRecordsGzip covers feeding streamBulkRecords the decompressed
+// reader the bulk handler hands it for a gzip-encoded request body.
+func TestStreamBulkRecordsGzip(t *testing.T) {
+    var buf bytes.Buffer
+    gzWriter := gzip.NewWriter(&buf)
+    if _, err := gzWriter.Write([]byte("{\"event\":\"a\"}\n{\"event\":\"b\"}\n")); err != nil {
+        t.Fatalf("write gzip body: %v", err)
+    }
+    if err := gzWriter.Close(); err != nil {
+        t.Fatalf("close gzip writer: %v", err)
+    }
+
+    gzReader, err := gzip.NewReader(&buf)
+    if err != nil {
+        t.Fatalf("open gzip reader: %v", err)
+    }
+    defer gzReader.Close()
+
+    var events []string
+    err = streamBulkRecords(gzReader, func(rec PostAnalytic) error {
+        events = append(events, rec.Event)
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("streamBulkRecords: %v", err)
+    }
+    if len(events) != 2 || events[0] != "a" || events[1] != "b" {
+        t.Fatalf("events = %v, want [a b]", events)
+    }
+}
+
+// TestStreamBulkRecordsMidStreamMalformedRecord covers a malformed record
+// partway through the stream: every record decoded before it must still
+// reach onRecord, and the malformed one surfaces as an error rather than
+// silently truncating or losing the records already seen.
+func TestStreamBulkRecordsMidStreamMalformedRecord(t *testing.T) {
+    body := strings.NewReader("{\"event\":\"a\"}\n{\"event\":\"b\"\n{\"event\":\"c\"}\n")
+
+    var events []string
+    err := streamBulkRecords(body, func(rec PostAnalytic) error {
+        events = append(events, rec.Event)
+        return nil
+    })
+    if err == nil {
+        t.Fatal("streamBulkRecords: want error for malformed record, got nil")
+    }
+    if len(events) != 1 || events[0] != "a" {
+        t.Fatalf("events before the malformed record = %v, want [a]", events)
+    }
+}
+
+// TestBulkInsertResultAddErrorCapsErrors covers the bulkMaxErrors cap: Failed
+// must keep counting every failure, but Errors must stop growing once it
+// hits the cap so a systematically failing stream can't grow it unbounded.
+func TestBulkInsertResultAddErrorCapsErrors(t *testing.T) {
+    result := bulkInsertResult{}
+
+    for i := 0; i < bulkMaxErrors+10; i++ {
+        result.addError("boom", 1)
+    }
+
+    if result.Failed != bulkMaxErrors+10 {
+        t.Errorf("Failed = %d, want %d", result.Failed, bulkMaxErrors+10)
+    }
+    if len(result.Errors) != bulkMaxErrors {
+        t.Errorf("len(Errors) = %d, want %d", len(result.Errors), bulkMaxErrors)
+    }
+}
+
+// TestBulkInsertResultAddErrorCountsBatchFailures covers addError being
+// called with n > 1, the shape used when an entire batch fails at once: the
+// batch's failure count is recorded, but only one error string per call.
+func TestBulkInsertResultAddErrorCountsBatchFailures(t *testing.T) {
+    result := bulkInsertResult{}
+
+    result.addError("batch failed", 500)
+
+    if result.Failed != 500 {
+        t.Errorf("Failed = %d, want 500", result.Failed)
+    }
+    if len(result.Errors) != 1 {
+        t.Errorf("len(Errors) = %d, want 1", len(result.Errors))
+    }
+}
@@ -0,0 +1,28 @@
+package errors
+
+import "net/http"
+
+// HTTPError is a JSON-renderable error carrying the HTTP status to send back
+// to the client.
+type HTTPError struct {
+    Code    int    `json:"code"`
+    Message string `json:"message"`
+}
+
+func (e HTTPError) Error() string {
+    return e.Message
+}
+
+var (
+    InternalError       = HTTPError{http.StatusInternalServerError, "Internal server error"}
+    InvalidDatabaseName = HTTPError{http.StatusNotFound, "Invalid database name"}
+    InvalidTimeFormat   = HTTPError{http.StatusBadRequest, "Invalid time format"}
+    InvalidInterval     = HTTPError{http.StatusBadRequest, "Invalid interval"}
+    InvalidProperty     = HTTPError{http.StatusBadRequest, "Invalid property"}
+    InvalidJSON         = HTTPError{http.StatusBadRequest, "Invalid JSON"}
+    InsertFailed        = HTTPError{http.StatusInternalServerError, "Failed to insert analytic"}
+    Unauthorized        = HTTPError{http.StatusUnauthorized, "Missing or invalid token"}
+    Forbidden           = HTTPError{http.StatusForbidden, "Token doesn't cover this database or method"}
+    MissingQuery        = HTTPError{http.StatusBadRequest, "Missing q parameter"}
+    SearchUnsupported   = HTTPError{http.StatusNotImplemented, "Full-text search isn't supported by this storage backend"}
+)
@@ -0,0 +1,128 @@
+// Package metrics exposes the Prometheus collectors micro-analytics reports
+// on its /metrics route: per-DB insert counters, per-endpoint query latency,
+// cache hit/miss counters, and whatever gauges a Store implementing Hook reports.
+package metrics
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry bundles every collector micro-analytics reports, registered
+// against a private prometheus.Registry so metrics don't leak into any
+// other instance a host process might run.
+type Registry struct {
+    registry *prometheus.Registry
+
+    InsertsTotal      *prometheus.CounterVec
+    InsertErrorsTotal *prometheus.CounterVec
+    QueryDuration     *prometheus.HistogramVec
+    CacheHits         prometheus.Counter
+    CacheMisses       prometheus.Counter
+}
+
+// NewRegistry builds and registers every collector.
+func NewRegistry() *Registry {
+    reg := &Registry{
+        registry: prometheus.NewRegistry(),
+        InsertsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Name: "micro_analytics_inserts_total",
+            Help: "Analytics successfully inserted, per DB.",
+        }, []string{"db"}),
+        InsertErrorsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Name: "micro_analytics_insert_errors_total",
+            Help: "Analytic inserts that failed, per DB.",
+        }, []string{"db"}),
+        QueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Name:    "micro_analytics_query_duration_seconds",
+            Help:    "Request latency, per endpoint.",
+            Buckets: prometheus.DefBuckets,
+        }, []string{"endpoint"}),
+        CacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+            Name: "micro_analytics_cache_hits_total",
+            Help: "Requests served from the response cache.",
+        }),
+        CacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+            Name: "micro_analytics_cache_misses_total",
+            Help: "Requests that missed the response cache.",
+        }),
+    }
+
+    reg.registry.MustRegister(
+        reg.InsertsTotal,
+        reg.InsertErrorsTotal,
+        reg.QueryDuration,
+        reg.CacheHits,
+        reg.CacheMisses,
+    )
+
+    return reg
+}
+
+// Hook lets a Store report backend-specific gauges (pool size, evictions,
+// lock wait time, ...) without the metrics package knowing about any
+// specific backend.
+type Hook interface {
+    // Describe reports the hook's current gauge values; report is called
+    // once per gauge, using a dotted name (e.g. "pool.open_dbs").
+    Describe(report func(name string, value float64))
+}
+
+// RegisterHook wires a backend's gauges into this registry as one
+// micro_analytics_store_<name> GaugeFunc per reported value, read on every
+// /metrics scrape.
+func (r *Registry) RegisterHook(hook Hook) {
+    reported := map[string]bool{}
+
+    hook.Describe(func(name string, value float64) {
+        if reported[name] {
+            return
+        }
+        reported[name] = true
+
+        metricName := "micro_analytics_store_" + sanitize(name)
+        r.registry.MustRegister(prometheus.NewGaugeFunc(
+            prometheus.GaugeOpts{Name: metricName, Help: "Store-reported gauge: " + name},
+            func() float64 {
+                var v float64
+                hook.Describe(func(n string, value float64) {
+                    if n == name {
+                        v = value
+                    }
+                })
+                return v
+            },
+        ))
+    })
+}
+
+func sanitize(name string) string {
+    out := make([]byte, len(name))
+    for i := 0; i < len(name); i++ {
+        c := name[i]
+        if c == '.' || c == '-' || c == ' ' {
+            out[i] = '_'
+        } else {
+            out[i] = c
+        }
+    }
+    return string(out)
+}
+
+// Handler serves the registry's collectors in Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+    return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{})
+}
+
+// Instrument wraps next so every call is timed into QueryDuration under
+// label endpoint.
+func (r *Registry) Instrument(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, req *http.Request) {
+        start := time.Now()
+        next(w, req)
+        r.QueryDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+    }
+}
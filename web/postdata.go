@@ -0,0 +1,26 @@
+package web
+
+// PostData is the payload accepted by POST /{dbName}: a raw client-side event
+// that still needs enrichment (GeoIP, platform, referer) before insertion.
+type PostData struct {
+    Time    string            `json:"time"`
+    Event   string            `json:"event"`
+    Path    string            `json:"path"`
+    Ip      string            `json:"ip"`
+    Headers map[string]string `json:"headers"`
+}
+
+// PostAnalytic is the payload accepted by POST /{dbName}/special: an
+// already-enriched record inserted as-is. Headers is only read by the bulk
+// endpoint's non-special variant, where it drives the same enrichment as
+// PostData.
+type PostAnalytic struct {
+    Time          float64           `json:"time"`
+    Event         string            `json:"event"`
+    Path          string            `json:"path"`
+    Ip            string            `json:"ip"`
+    Platform      string            `json:"platform"`
+    RefererDomain string            `json:"refererDomain"`
+    CountryCode   string            `json:"countryCode"`
+    Headers       map[string]string `json:"headers,omitempty"`
+}
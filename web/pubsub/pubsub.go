@@ -0,0 +1,68 @@
+// Package pubsub fans out newly inserted analytics to live subscribers (the
+// websocket live-tail endpoint), one topic per dbName.
+package pubsub
+
+import (
+    "sync"
+
+    "github.com/GitbookIO/micro-analytics/database"
+)
+
+// subscriberBufferSize bounds how many unread analytics a subscriber can
+// fall behind by before it's considered slow and dropped.
+const subscriberBufferSize = 64
+
+// Broker fans out Analytic inserts to subscribers of a given dbName.
+type Broker struct {
+    mu     sync.Mutex
+    topics map[string]map[chan database.Analytic]struct{}
+}
+
+// NewBroker returns an empty Broker, ready to use.
+func NewBroker() *Broker {
+    return &Broker{
+        topics: make(map[string]map[chan database.Analytic]struct{}),
+    }
+}
+
+// Publish fans analytic out to every current subscriber of dbName. A
+// subscriber whose buffer is full is dropped rather than blocking the
+// publisher.
+func (b *Broker) Publish(dbName string, analytic database.Analytic) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    for ch := range b.topics[dbName] {
+        select {
+        case ch <- analytic:
+        default:
+            delete(b.topics[dbName], ch)
+            close(ch)
+        }
+    }
+}
+
+// Subscribe registers a new subscriber to dbName, returning the channel it
+// will receive Analytics on and a function to unsubscribe and release it.
+func (b *Broker) Subscribe(dbName string) (<-chan database.Analytic, func()) {
+    ch := make(chan database.Analytic, subscriberBufferSize)
+
+    b.mu.Lock()
+    if b.topics[dbName] == nil {
+        b.topics[dbName] = make(map[chan database.Analytic]struct{})
+    }
+    b.topics[dbName][ch] = struct{}{}
+    b.mu.Unlock()
+
+    unsubscribe := func() {
+        b.mu.Lock()
+        defer b.mu.Unlock()
+
+        if _, ok := b.topics[dbName][ch]; ok {
+            delete(b.topics[dbName], ch)
+            close(ch)
+        }
+    }
+
+    return ch, unsubscribe
+}
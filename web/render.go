@@ -0,0 +1,33 @@
+package web
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "github.com/GitbookIO/micro-analytics/web/errors"
+)
+
+// render writes data as a JSON response, or delegates to renderError if err
+// is set.
+func render(w http.ResponseWriter, data interface{}, err error) {
+    if err != nil {
+        renderError(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(data)
+}
+
+// renderError writes err as a JSON error response, using its HTTP status code
+// when err is an *errors.HTTPError, or 500 otherwise.
+func renderError(w http.ResponseWriter, err error) {
+    httpErr, ok := err.(*errors.HTTPError)
+    if !ok {
+        httpErr = &errors.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(httpErr.Code)
+    json.NewEncoder(w).Encode(httpErr)
+}
@@ -1,7 +1,10 @@
 package web
 
 import (
+    "compress/gzip"
+    "crypto/subtle"
     "encoding/json"
+    "io"
     "net/http"
     "net/url"
     "strconv"
@@ -10,26 +13,87 @@ import (
 
     "github.com/azer/logger"
     "github.com/gorilla/mux"
+    "github.com/gorilla/websocket"
     "github.com/oschwald/maxminddb-golang"
 
     "github.com/GitbookIO/micro-analytics/database"
     "github.com/GitbookIO/micro-analytics/utils"
     "github.com/GitbookIO/micro-analytics/utils/geoip"
     "github.com/GitbookIO/micro-analytics/web/errors"
+    "github.com/GitbookIO/micro-analytics/web/metrics"
+    "github.com/GitbookIO/micro-analytics/web/pubsub"
 )
 
 type RouterOpts struct {
-    DBManager      *database.DBManager
+    Store          database.Store
     Geolite2Reader *maxminddb.Reader
     Version        string
+    // Broker fans out inserts to GET /{dbName}/live subscribers. A zero
+    // value is replaced with a fresh, private Broker.
+    Broker *pubsub.Broker
+
+    // JWTPublicKey, when set, requires every /{dbName}... request to carry a
+    // `dbs`/`scopes`-scoped Bearer token verifiable against it. It's either
+    // an *rsa.PublicKey (RS256 tokens) or a []byte HMAC secret (HS256).
+    JWTPublicKey interface{}
+    // JWTSigningKey enables POST /_auth/token to mint HS256 tokens. Callers
+    // must still know TokenMintSecret to use that route.
+    JWTSigningKey []byte
+    // TokenMintSecret gates POST /_auth/token: the request body's `secret`
+    // field must match it.
+    TokenMintSecret string
+
+    // Metrics collects the Prometheus series served on GET /metrics. A zero
+    // value is replaced with a fresh, private Registry.
+    Metrics *metrics.Registry
 }
 
+var upgrader = websocket.Upgrader{
+    ReadBufferSize:  1024,
+    WriteBufferSize: 1024,
+    CheckOrigin:     func(req *http.Request) bool { return true },
+}
+
+const (
+    // liveReadWait bounds how long a /{dbName}/live connection can go
+    // without a frame (including a pong) from the client before it's
+    // considered dead and the subscription is torn down.
+    liveReadWait = 60 * time.Second
+    // livePingPeriod is how often the server pings an otherwise-silent
+    // subscriber to solicit the pong that keeps liveReadWait from expiring
+    // on a perfectly healthy, just-quiet connection. Kept well under
+    // liveReadWait so a pong has time to land before the read deadline.
+    livePingPeriod = liveReadWait / 2
+    // liveWriteWait bounds how long writing a control frame (ping or close)
+    // to a subscriber is allowed to block.
+    liveWriteWait = 10 * time.Second
+)
+
 func NewRouter(opts RouterOpts) http.Handler {
     // Create the app router
     r := mux.NewRouter()
-    dbManager := opts.DBManager
+    store := opts.Store
     geolite2 := opts.Geolite2Reader
 
+    broker := opts.Broker
+    if broker == nil {
+        broker = pubsub.NewBroker()
+    }
+
+    reg := opts.Metrics
+    if reg == nil {
+        reg = metrics.NewRegistry()
+    }
+    if hook, ok := store.(metrics.Hook); ok {
+        reg.RegisterHook(hook)
+    }
+
+    if opts.JWTPublicKey != nil {
+        r.Use(func(next http.Handler) http.Handler {
+            return jwtMiddleware(opts.JWTPublicKey, next)
+        })
+    }
+
     var log = logger.New("[Router]")
 
     /////
@@ -46,18 +110,67 @@ func NewRouter(opts RouterOpts) http.Handler {
         render(w, msg, nil)
     })
 
+    /////
+    // Prometheus metrics
+    /////
+    r.Path("/metrics").
+        Methods("GET").
+        Handler(reg.Handler())
+
+    /////
+    // Mint a scoped JWT
+    /////
+    r.Path("/_auth/token").
+        Methods("POST").
+        HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        if len(opts.JWTSigningKey) == 0 {
+            renderError(w, &errors.InternalError)
+            return
+        }
+
+        var body struct {
+            Secret string   `json:"secret"`
+            Dbs    []string `json:"dbs"`
+            Scopes []string `json:"scopes"`
+            TTL    int64    `json:"ttl"`
+        }
+
+        if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+            renderError(w, &errors.InvalidJSON)
+            return
+        }
+
+        if len(opts.TokenMintSecret) == 0 || subtle.ConstantTimeCompare([]byte(body.Secret), []byte(opts.TokenMintSecret)) != 1 {
+            renderError(w, &errors.Unauthorized)
+            return
+        }
+
+        ttl := time.Duration(body.TTL) * time.Second
+        if ttl <= 0 {
+            ttl = time.Hour
+        }
+
+        token, err := mintToken(opts.JWTSigningKey, body.Dbs, body.Scopes, ttl)
+        if err != nil {
+            renderError(w, &errors.InternalError)
+            return
+        }
+
+        render(w, map[string]string{"token": token}, nil)
+    })
+
     /////
     // Query a DB over time
     /////
     r.Path("/{dbName}/time").
         Methods("GET").
-        HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        HandlerFunc(reg.Instrument("/time", func(w http.ResponseWriter, req *http.Request) {
         // Get params from URL
         vars := mux.Vars(req)
         dbName := vars["dbName"]
 
         // Check if DB file exists
-        dbExists, err := dbManager.DBExists(dbName)
+        dbExists, err := store.DBExists(dbName)
         if err != nil {
             renderError(w, &errors.InternalError)
             return
@@ -100,44 +213,217 @@ func NewRouter(opts RouterOpts) http.Handler {
             }
         }
 
-        // Get DB from manager
-        dbManager.RequestDB <- dbName
-        db := <-dbManager.SendDB
-
         // If value is in Cache, return directly
-        response, inCache := dbManager.Cache.Get(req.URL.String())
-        if inCache {
-            dbManager.UnlockDB <- dbName
+        if response, inCache := store.Cache().Get(req.URL.String()); inCache {
+            reg.CacheHits.Inc()
             render(w, response, nil)
             return
         }
+        reg.CacheMisses.Inc()
 
         // Check for unique query parameter to call function accordingly
         var analytics *database.Intervals
         unique := req.Form.Get("unique")
 
-        if strings.Compare(unique, "true") == 0 {
-            analytics, err = db.OverTimeUniq(interval, timeRange)
-            if err != nil {
-                renderError(w, &errors.InternalError)
-                return
+        err = store.WithDB(req.Context(), dbName, func(db database.DB) error {
+            if strings.Compare(unique, "true") == 0 {
+                analytics, err = db.OverTimeUniq(req.Context(), interval, timeRange)
+            } else {
+                analytics, err = db.OverTime(req.Context(), interval, timeRange)
             }
-        } else {
-            analytics, err = db.OverTime(interval, timeRange)
+            return err
+        })
+        if err != nil {
+            renderError(w, &errors.InternalError)
+            return
+        }
+
+        // Store response in Cache before sending
+        store.Cache().Add(req.URL.String(), analytics)
+
+        // Return query result
+        render(w, analytics, nil)
+    }))
+
+    /////
+    // Full-text search over path/event
+    /////
+    r.Path("/{dbName}/search").
+        Methods("GET").
+        HandlerFunc(reg.Instrument("/search", func(w http.ResponseWriter, req *http.Request) {
+        // Get params from URL
+        vars := mux.Vars(req)
+        dbName := vars["dbName"]
+
+        // Check if DB file exists
+        dbExists, err := store.DBExists(dbName)
+        if err != nil {
+            renderError(w, &errors.InternalError)
+            return
+        }
+
+        // DB doesn't exist
+        if !dbExists {
+            renderError(w, &errors.InvalidDatabaseName)
+            return
+        }
+
+        // Parse request query
+        if err := req.ParseForm(); err != nil {
+            renderError(w, err)
+            return
+        }
+
+        q := req.Form.Get("q")
+        if len(q) == 0 {
+            renderError(w, &errors.MissingQuery)
+            return
+        }
+
+        // Get timeRange if provided
+        startTime := req.Form.Get("start")
+        endTime := req.Form.Get("end")
+
+        timeRange, err := database.NewTimeRange(startTime, endTime)
+        if err != nil {
+            log.Info("Error creating TimeRange %v", err)
+            renderError(w, &errors.InvalidTimeFormat)
+            return
+        }
+
+        // Cast limit to an integer
+        // Defaults to 100 results
+        limit := 100
+        if limitStr := req.Form.Get("limit"); len(limitStr) > 0 {
+            limit, err = strconv.Atoi(limitStr)
             if err != nil {
-                renderError(w, &errors.InternalError)
+                log.Info("Error casting limit to an int %v", err)
+                renderError(w, &errors.InvalidJSON)
                 return
             }
         }
 
-        // Unlock DB
-        dbManager.UnlockDB <- dbName
+        var analytics *database.AnalyticsList
+        err = store.WithDB(req.Context(), dbName, func(db database.DB) error {
+            searcher, ok := db.(database.Searcher)
+            if !ok {
+                return &errors.SearchUnsupported
+            }
 
-        // Store response in Cache before sending
-        dbManager.Cache.Add(req.URL.String(), analytics)
+            var err error
+            analytics, err = searcher.Search(req.Context(), q, timeRange, limit)
+            return err
+        })
+        if err != nil {
+            if httpErr, ok := err.(*errors.HTTPError); ok {
+                renderError(w, httpErr)
+            } else {
+                renderError(w, &errors.InternalError)
+            }
+            return
+        }
 
-        // Return query result
         render(w, analytics, nil)
+    }))
+
+    /////
+    // Live-tail newly inserted analytics over a websocket
+    /////
+    r.Path("/{dbName}/live").
+        Methods("GET").
+        HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        // Get params from URL
+        vars := mux.Vars(req)
+        dbName := vars["dbName"]
+
+        // Check if DB file exists
+        dbExists, err := store.DBExists(dbName)
+        if err != nil {
+            renderError(w, &errors.InternalError)
+            return
+        }
+
+        // DB doesn't exist
+        if !dbExists {
+            renderError(w, &errors.InvalidDatabaseName)
+            return
+        }
+
+        conn, err := upgrader.Upgrade(w, req, nil)
+        if err != nil {
+            log.Error("Failed to upgrade %s to a websocket: %v", dbName, err)
+            return
+        }
+        defer conn.Close()
+
+        // Optional server-side filters
+        eventFilter := req.URL.Query().Get("event")
+        pathFilter := req.URL.Query().Get("path")
+        countryFilter := req.URL.Query().Get("countryCode")
+
+        analytics, unsubscribe := broker.Subscribe(dbName)
+        defer unsubscribe()
+
+        // Read pump: we never expect incoming frames, but we still need to
+        // read from the connection so a client that drops without closing
+        // (network loss, tab closed) is detected even if no insert ever
+        // arrives to publish against the dead socket. Any pong or frame
+        // pushes the deadline out; a read error or timeout ends the
+        // connection.
+        done := make(chan struct{})
+        conn.SetReadDeadline(time.Now().Add(liveReadWait))
+        conn.SetPongHandler(func(string) error {
+            conn.SetReadDeadline(time.Now().Add(liveReadWait))
+            return nil
+        })
+        go func() {
+            defer close(done)
+            for {
+                if _, _, err := conn.ReadMessage(); err != nil {
+                    return
+                }
+                conn.SetReadDeadline(time.Now().Add(liveReadWait))
+            }
+        }()
+
+        pingTicker := time.NewTicker(livePingPeriod)
+        defer pingTicker.Stop()
+
+        for {
+            select {
+            case <-pingTicker.C:
+                if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+                    return
+                }
+            case analytic, ok := <-analytics:
+                if !ok {
+                    // Broker dropped us for falling too far behind; let the
+                    // client know why instead of just vanishing.
+                    conn.WriteControl(
+                        websocket.CloseMessage,
+                        websocket.FormatCloseMessage(websocket.CloseMessageTooBig, "slow consumer dropped"),
+                        time.Now().Add(liveWriteWait),
+                    )
+                    return
+                }
+
+                if len(eventFilter) > 0 && analytic.Event != eventFilter {
+                    continue
+                }
+                if len(pathFilter) > 0 && analytic.Path != pathFilter {
+                    continue
+                }
+                if len(countryFilter) > 0 && analytic.CountryCode != countryFilter {
+                    continue
+                }
+
+                if err := conn.WriteJSON(analytic); err != nil {
+                    return
+                }
+            case <-done:
+                return
+            }
+        }
     })
 
     /////
@@ -145,7 +431,7 @@ func NewRouter(opts RouterOpts) http.Handler {
     /////
     r.Path("/{dbName}/{property}").
         Methods("GET").
-        HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        HandlerFunc(reg.Instrument("/{property}", func(w http.ResponseWriter, req *http.Request) {
         // Map allowed requests w/ columns names in DB schema
         allowedProperties := map[string]string{
             "countries": "countryCode",
@@ -166,7 +452,7 @@ func NewRouter(opts RouterOpts) http.Handler {
         }
 
         // Check if DB file exists
-        dbExists, err := dbManager.DBExists(dbName)
+        dbExists, err := store.DBExists(dbName)
         if err != nil {
             renderError(w, &errors.InternalError)
             return
@@ -195,52 +481,44 @@ func NewRouter(opts RouterOpts) http.Handler {
             return
         }
 
-        // Get DB from manager
-        dbManager.RequestDB <- dbName
-        db := <-dbManager.SendDB
-
         // If value is in Cache, return directly
-        response, inCache := dbManager.Cache.Get(req.URL.String())
-        if inCache {
-            dbManager.UnlockDB <- dbName
+        if response, inCache := store.Cache().Get(req.URL.String()); inCache {
+            reg.CacheHits.Inc()
             render(w, response, nil)
             return
         }
+        reg.CacheMisses.Inc()
 
         // Check for unique query parameter to call function accordingly
         var analytics *database.AggregateList
         unique := req.Form.Get("unique")
 
-        if strings.Compare(unique, "true") == 0 {
-            analytics, err = db.GroupByUniq(property, timeRange)
-            if err != nil {
-                renderError(w, &errors.InternalError)
-                return
-            }
-        } else {
-            analytics, err = db.GroupBy(property, timeRange)
-            if err != nil {
-                renderError(w, &errors.InternalError)
-                return
+        err = store.WithDB(req.Context(), dbName, func(db database.DB) error {
+            if strings.Compare(unique, "true") == 0 {
+                analytics, err = db.GroupByUniq(req.Context(), property, timeRange)
+            } else {
+                analytics, err = db.GroupBy(req.Context(), property, timeRange)
             }
+            return err
+        })
+        if err != nil {
+            renderError(w, &errors.InternalError)
+            return
         }
 
-        // Unlock DB
-        dbManager.UnlockDB <- dbName
-
         // Store response in Cache before sending
-        dbManager.Cache.Add(req.URL.String(), analytics)
+        store.Cache().Add(req.URL.String(), analytics)
 
         // Return query result
         render(w, analytics, nil)
-    })
+    }))
 
     /////
     // Full query a DB
     /////
     r.Path("/{dbName}").
         Methods("GET").
-        HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        HandlerFunc(reg.Instrument("/{dbName}", func(w http.ResponseWriter, req *http.Request) {
 
         // Parse form data
         if err := req.ParseForm(); err != nil {
@@ -253,7 +531,7 @@ func NewRouter(opts RouterOpts) http.Handler {
         dbName := vars["dbName"]
 
         // Check if DB file exists
-        dbExists, err := dbManager.DBExists(dbName)
+        dbExists, err := store.DBExists(dbName)
         if err != nil {
             renderError(w, &errors.InternalError)
             return
@@ -282,33 +560,31 @@ func NewRouter(opts RouterOpts) http.Handler {
             return
         }
 
-        // Get DB from manager
-        dbManager.RequestDB <- dbName
-        db := <-dbManager.SendDB
-
         // If value is in Cache, return directly
-        response, inCache := dbManager.Cache.Get(req.URL.String())
-        if inCache {
-            dbManager.UnlockDB <- dbName
+        if response, inCache := store.Cache().Get(req.URL.String()); inCache {
+            reg.CacheHits.Inc()
             render(w, response, nil)
             return
         }
+        reg.CacheMisses.Inc()
 
         // Return query result
-        analytics, err := db.Query(timeRange)
+        var analytics *database.AnalyticsList
+        err = store.WithDB(req.Context(), dbName, func(db database.DB) error {
+            var err error
+            analytics, err = db.Query(req.Context(), timeRange)
+            return err
+        })
         if err != nil {
             renderError(w, &errors.InternalError)
             return
         }
 
-        // Unlock DB
-        dbManager.UnlockDB <- dbName
-
         // Store response in Cache before sending
-        dbManager.Cache.Add(req.URL.String(), analytics)
+        store.Cache().Add(req.URL.String(), analytics)
 
         render(w, analytics, nil)
-    })
+    }))
 
     /////
     // Push analytics to a DB
@@ -357,20 +633,20 @@ func NewRouter(opts RouterOpts) http.Handler {
         // Get countryCode from GeoIp
         analytic.CountryCode, err = geoip.GeoIpLookup(geolite2, postData.Ip)
 
-        // Get DB from manager
-        dbManager.RequestDB <- dbName
-        db := <-dbManager.SendDB
-
         // Insert data if everything's OK
-        if err = db.Insert(analytic); err != nil {
+        if err = store.WithDB(req.Context(), dbName, func(db database.DB) error {
+            return db.Insert(req.Context(), analytic)
+        }); err != nil {
+            reg.InsertErrorsTotal.WithLabelValues(dbName).Inc()
             renderError(w, &errors.InsertFailed)
             return
         }
+        reg.InsertsTotal.WithLabelValues(dbName).Inc()
+        store.Cache().Clear()
 
         log.Info("Successfully inserted analytic: %#v", analytic)
 
-        // Unlock DB
-        dbManager.UnlockDB <- dbName
+        broker.Publish(dbName, analytic)
 
         render(w, nil, nil)
     })
@@ -407,24 +683,149 @@ func NewRouter(opts RouterOpts) http.Handler {
             CountryCode:   postData.CountryCode,
         }
 
-        // Get DB from manager
-        dbManager.RequestDB <- dbName
-        db := <-dbManager.SendDB
-
         // Insert data
-        if err = db.Insert(analytic); err != nil {
+        if err = store.WithDB(req.Context(), dbName, func(db database.DB) error {
+            return db.Insert(req.Context(), analytic)
+        }); err != nil {
+            reg.InsertErrorsTotal.WithLabelValues(dbName).Inc()
             renderError(w, &errors.InsertFailed)
             return
         }
+        reg.InsertsTotal.WithLabelValues(dbName).Inc()
+        store.Cache().Clear()
 
         log.Info("Successfully inserted analytic: %#v", analytic)
 
-        // Unlock DB
-        dbManager.UnlockDB <- dbName
+        broker.Publish(dbName, analytic)
 
         render(w, nil, nil)
     })
 
+    /////
+    // Bulk-insert many analytics in one request
+    /////
+    r.Path("/{dbName}/bulk").
+        Methods("POST").
+        HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        // Get dbName from URL
+        vars := mux.Vars(req)
+        dbName := vars["dbName"]
+
+        // Check if DB file exists
+        dbExists, err := store.DBExists(dbName)
+        if err != nil {
+            renderError(w, &errors.InternalError)
+            return
+        }
+
+        // DB doesn't exist
+        if !dbExists {
+            renderError(w, &errors.InvalidDatabaseName)
+            return
+        }
+
+        // Transparently decompress gzip-encoded bodies
+        body := io.Reader(req.Body)
+        if strings.EqualFold(req.Header.Get("Content-Encoding"), "gzip") {
+            gzReader, err := gzip.NewReader(req.Body)
+            if err != nil {
+                renderError(w, &errors.InvalidJSON)
+                return
+            }
+            defer gzReader.Close()
+            body = gzReader
+        }
+
+        // Records are already enriched unless this is the raw, non-special
+        // variant, in which case we run the same GeoIP/UA/referer enrichment
+        // as the single-record POST /{dbName} route
+        special := req.URL.Query().Get("special") == "true"
+
+        result := bulkInsertResult{}
+        var streamErr error
+
+        err = store.WithDB(req.Context(), dbName, func(db database.DB) error {
+            batch := make([]database.Analytic, 0, bulkBatchSize)
+
+            flush := func() {
+                if len(batch) == 0 {
+                    return
+                }
+
+                insertErrs, err := db.BulkInsert(req.Context(), batch)
+                if err != nil {
+                    result.addError(err.Error(), len(batch))
+                    reg.InsertErrorsTotal.WithLabelValues(dbName).Add(float64(len(batch)))
+                } else {
+                    for i, insertErr := range insertErrs {
+                        if insertErr != nil {
+                            result.addError(insertErr.Error(), 1)
+                            reg.InsertErrorsTotal.WithLabelValues(dbName).Inc()
+                        } else {
+                            result.Inserted++
+                            reg.InsertsTotal.WithLabelValues(dbName).Inc()
+                            broker.Publish(dbName, batch[i])
+                        }
+                    }
+                }
+
+                batch = batch[:0]
+            }
+
+            streamErr = streamBulkRecords(body, func(rec PostAnalytic) error {
+                analytic := database.Analytic{
+                    Time:          time.Unix(int64(rec.Time), 0),
+                    Event:         rec.Event,
+                    Path:          rec.Path,
+                    Ip:            rec.Ip,
+                    Platform:      rec.Platform,
+                    RefererDomain: rec.RefererDomain,
+                    CountryCode:   rec.CountryCode,
+                }
+
+                if !special {
+                    analytic.Platform = utils.Platform(rec.Headers["user-agent"])
+                    if referrerURL, err := url.ParseRequestURI(rec.Headers["referer"]); err == nil {
+                        analytic.RefererDomain = referrerURL.Host
+                    }
+                    analytic.CountryCode, _ = geoip.GeoIpLookup(geolite2, rec.Ip)
+                }
+
+                batch = append(batch, analytic)
+                if len(batch) >= bulkBatchSize {
+                    flush()
+                }
+                return nil
+            })
+            flush()
+
+            return nil
+        })
+        if err != nil {
+            renderError(w, &errors.InternalError)
+            return
+        }
+
+        if streamErr != nil {
+            // A mid-stream parse error stops decoding, but everything
+            // flushed before it landed for real: report it as one more
+            // failure in the result instead of discarding the counts for
+            // records that were already committed.
+            result.addError(streamErr.Error(), 1)
+        }
+
+        // Bulk inserts invalidate every cached query, but only if anything
+        // actually landed. The cache is shared by every DB in the store, so
+        // this clears other DBs' entries too.
+        if result.Inserted > 0 {
+            store.Cache().Clear()
+        }
+
+        log.Info("Bulk-inserted %d analytics (%d failed) into %s", result.Inserted, result.Failed, dbName)
+
+        render(w, result, nil)
+    })
+
     /////
     // Delete a DB
     /////
@@ -437,7 +838,7 @@ func NewRouter(opts RouterOpts) http.Handler {
         dbName := vars["dbName"]
 
         // Check if DB file exists
-        dbExists, err := dbManager.DBExists(dbName)
+        dbExists, err := store.DBExists(dbName)
         if err != nil {
             renderError(w, &errors.InternalError)
             return
@@ -450,7 +851,7 @@ func NewRouter(opts RouterOpts) http.Handler {
         }
 
         // Delete full DB directory
-        err = dbManager.DeleteDB(dbName)
+        err = store.DeleteDB(dbName)
         render(w, nil, err)
     })
 
@@ -0,0 +1,63 @@
+package web
+
+import (
+    "context"
+    "net/http"
+    "time"
+)
+
+// ServerOpts configures the timeouts NewServer applies to the underlying
+// http.Server. A zero value for any field leaves Go's http.Server default
+// (no timeout) in place.
+type ServerOpts struct {
+    Addr string
+
+    ReadTimeout       time.Duration
+    ReadHeaderTimeout time.Duration
+    WriteTimeout      time.Duration
+    IdleTimeout       time.Duration
+}
+
+// Server wraps the router's http.Server together with the Store backing it,
+// so Shutdown can close both in order.
+type Server struct {
+    httpServer *http.Server
+    store      func() error
+}
+
+// NewServer builds a Server from RouterOpts and ServerOpts. routerOpts.Store
+// is closed by Shutdown once the http.Server has stopped accepting requests.
+func NewServer(routerOpts RouterOpts, opts ServerOpts) *Server {
+    return &Server{
+        httpServer: &http.Server{
+            Addr:              opts.Addr,
+            Handler:           NewRouter(routerOpts),
+            ReadTimeout:       opts.ReadTimeout,
+            ReadHeaderTimeout: opts.ReadHeaderTimeout,
+            WriteTimeout:      opts.WriteTimeout,
+            IdleTimeout:       opts.IdleTimeout,
+        },
+        store: routerOpts.Store.Close,
+    }
+}
+
+// ListenAndServe starts serving and blocks until the server stops, either
+// because it failed to start or Shutdown was called. It never returns
+// http.ErrServerClosed.
+func (s *Server) ListenAndServe() error {
+    if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+        return err
+    }
+    return nil
+}
+
+// Shutdown stops the server from accepting new connections, waits for
+// in-flight handlers to finish (bounded by ctx), and then closes the Store.
+// If ctx expires before the handlers finish, Shutdown returns ctx's error
+// and leaves the Store open.
+func (s *Server) Shutdown(ctx context.Context) error {
+    if err := s.httpServer.Shutdown(ctx); err != nil {
+        return err
+    }
+    return s.store()
+}